@@ -0,0 +1,23 @@
+package counters
+
+import "context"
+
+/**
+Counter is a plain snapshot of a single counter's values, detached
+from the live, mutex-guarded struct it was read from so it can be
+handed to a Sink without holding any locks.
+*/
+type Counter struct {
+	View  int
+	Click int
+}
+
+/**
+Sink flushes a snapshot of counters, keyed by whatever key the caller
+used (e.g. "content:timeKey"), to a backing store. Implementations
+should treat ctx's deadline as authoritative and return promptly once
+it expires.
+*/
+type Sink interface {
+	Flush(ctx context.Context, snapshot map[string]Counter) error
+}
@@ -0,0 +1,80 @@
+package counters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+/**
+ElasticsearchSink bulk-indexes counters into an Elasticsearch index,
+one document per "content:timeKey" key, stamped with the flush time.
+*/
+type ElasticsearchSink struct {
+	client *elasticsearch.Client
+	index  string
+}
+
+/**
+elasticsearchDoc is the document shape indexed for each counter.
+*/
+type elasticsearchDoc struct {
+	Key       string    `json:"key"`
+	View      int       `json:"view"`
+	Click     int       `json:"click"`
+	FlushedAt time.Time `json:"flushed_at"`
+}
+
+/**
+NewElasticsearchSink builds an ElasticsearchSink that indexes into
+index using client.
+*/
+func NewElasticsearchSink(client *elasticsearch.Client, index string) *ElasticsearchSink {
+	return &ElasticsearchSink{client: client, index: index}
+}
+
+func (s *ElasticsearchSink) Flush(ctx context.Context, snapshot map[string]Counter) error {
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client: s.client,
+		Index:  s.index,
+	})
+	if err != nil {
+		return fmt.Errorf("counters: creating bulk indexer failed: %w", err)
+	}
+
+	flushedAt := time.Now()
+	for key, c := range snapshot {
+		doc, err := json.Marshal(elasticsearchDoc{
+			Key:       key,
+			View:      c.View,
+			Click:     c.Click,
+			FlushedAt: flushedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("counters: marshalling document for %q failed: %w", key, err)
+		}
+
+		err = indexer.Add(ctx, esutil.BulkIndexerItem{
+			Action: "index",
+			Body:   bytes.NewReader(doc),
+		})
+		if err != nil {
+			return fmt.Errorf("counters: queuing document for %q failed: %w", key, err)
+		}
+	}
+
+	if err := indexer.Close(ctx); err != nil {
+		return fmt.Errorf("counters: bulk index failed: %w", err)
+	}
+
+	if stats := indexer.Stats(); stats.NumFailed > 0 {
+		return fmt.Errorf("counters: %d documents failed to index", stats.NumFailed)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package counters
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+/**
+StdoutSink writes each counter as a line of text to an io.Writer
+(stdout by default). It's meant for local dev, where standing up
+Redis or Elasticsearch just to see counts flow isn't worth it.
+*/
+type StdoutSink struct {
+	writer io.Writer
+}
+
+/**
+NewStdoutSink builds a StdoutSink that writes to os.Stdout.
+*/
+func NewStdoutSink() *StdoutSink {
+	return &StdoutSink{writer: os.Stdout}
+}
+
+/**
+NewFileSink builds a StdoutSink that writes to w instead of stdout,
+e.g. an *os.File for a local log.
+*/
+func NewFileSink(w io.Writer) *StdoutSink {
+	return &StdoutSink{writer: w}
+}
+
+func (s *StdoutSink) Flush(ctx context.Context, snapshot map[string]Counter) error {
+	for key, c := range snapshot {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := fmt.Fprintf(s.writer, "%s view=%d click=%d\n", key, c.View, c.Click); err != nil {
+			return err
+		}
+	}
+	return nil
+}
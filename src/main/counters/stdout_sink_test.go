@@ -0,0 +1,43 @@
+package counters
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStdoutSinkFlushWritesOneLinePerCounter(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewFileSink(&buf)
+
+	err := sink.Flush(context.Background(), map[string]Counter{
+		"sports:2026-1-1 00:00": {View: 3, Click: 1},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := buf.String()
+	if !strings.Contains(got, "view=3") || !strings.Contains(got, "click=1") {
+		t.Fatalf("expected flushed line to report view/click counts, got %q", got)
+	}
+}
+
+func TestStdoutSinkFlushStopsOnCancelledContext(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewFileSink(&buf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := sink.Flush(ctx, map[string]Counter{
+		"sports:2026-1-1 00:00": {View: 1, Click: 1},
+	})
+	if err == nil {
+		t.Fatal("expected Flush to report an error for an already-cancelled context")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be written once the context was cancelled, got %q", buf.String())
+	}
+}
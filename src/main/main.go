@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	counterstore "eq/counters"
 	"eq/rate_limit"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -37,6 +40,17 @@ var (
 
 	// content options available
 	content = []string{"sports", "entertainment", "business", "education"}
+
+	// sink is where uploadCounters flushes snapshots to. Defaults to
+	// stdout for local dev; swap in counterstore.NewRedisSink or
+	// counterstore.NewElasticsearchSink for a real deployment.
+	sink counterstore.Sink = counterstore.NewStdoutSink()
+)
+
+const (
+	flushTimeout     = 5 * time.Second
+	maxFlushAttempts = 3
+	flushBackoff     = 200 * time.Millisecond
 )
 
 /**
@@ -59,14 +73,7 @@ func viewHandler(w http.ResponseWriter, r *http.Request) {
 	// Key for map
 	clickMapKey := fmt.Sprintf("%s:%s", data, timeKey)
 
-	// If they key does not exist in the map we create a new counter
-	if countersStruct.countersMap[clickMapKey] == nil {
-		countersStruct.countersMap[clickMapKey] = &counter{}
-	}
-	// increment count
-	countersStruct.countersMap[clickMapKey].Lock()
-	countersStruct.countersMap[clickMapKey].View += 1
-	countersStruct.countersMap[clickMapKey].Unlock()
+	incrementView(clickMapKey)
 
 	err := processRequest(r)
 	if err != nil {
@@ -86,6 +93,55 @@ func viewHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+/**
+incrementView bumps key's View count, looking up (or creating) its
+counter and incrementing it in one critical section under
+countersStruct's mutex. Holding countersStruct's lock across the
+counter's own lock is what stops a concurrent uploadCounters swap
+from detaching the counter between the lookup and the increment -
+splitting those into separate critical sections let an increment land
+on a counter that had already been (or was about to be) snapshotted
+and cleared, silently dropping it.
+*/
+func incrementView(key string) {
+	countersStruct.Lock()
+	defer countersStruct.Unlock()
+
+	c := getOrCreateCounterLocked(key)
+	c.Lock()
+	c.View += 1
+	c.Unlock()
+}
+
+/**
+incrementClick bumps key's Click count the same way incrementView
+bumps View - see incrementView for why countersStruct's mutex must be
+held across the lookup and the increment.
+*/
+func incrementClick(key string) {
+	countersStruct.Lock()
+	defer countersStruct.Unlock()
+
+	c := getOrCreateCounterLocked(key)
+	c.Lock()
+	c.Click += 1
+	c.Unlock()
+}
+
+/**
+getOrCreateCounterLocked looks up key in countersStruct.countersMap,
+creating a new counter if one doesn't exist yet. Callers must already
+hold countersStruct's mutex.
+*/
+func getOrCreateCounterLocked(key string) *counter {
+	c, exists := countersStruct.countersMap[key]
+	if !exists {
+		c = &counter{}
+		countersStruct.countersMap[key] = c
+	}
+	return c
+}
+
 func processRequest(r *http.Request) error {
 	time.Sleep(time.Duration(rand.Int31n(50)) * time.Millisecond)
 	return nil
@@ -95,58 +151,154 @@ func processRequest(r *http.Request) error {
 Increase click value for counter in map
 */
 func processClick(mapKey string) error {
-	countersStruct.countersMap[mapKey].Lock()
-	countersStruct.countersMap[mapKey].Click += 1
-	countersStruct.countersMap[mapKey].Unlock()
-
+	incrementClick(mapKey)
 	return nil
 }
 
 /**
 Stats handler not implemented
+route: /stats
 */
 func statsHandler(w http.ResponseWriter, r *http.Request) {
-	if !isAllowed() {
-		w.WriteHeader(429)
-		return
-	}
 }
 
-func isAllowed() bool {
-	return true
+/**
+routeAction maps a request's path to the MultiLimiter policy it
+should be rate limited under, so /stats/ can carry a stricter limit
+than /view/.
+*/
+func routeAction(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/view/"):
+		return "view"
+	case strings.HasPrefix(r.URL.Path, "/stats/"):
+		return "stats"
+	default:
+		return "default"
+	}
 }
 
 /**
-Mock function to upload counter info to a backing store ie elastic or redis
-Called on an 5 second interval
+Upload counter info to the configured backing store.
+Called on a 5 second interval.
+
+Swaps countersStruct.countersMap for a fresh empty map under the
+mutex, then flushes the detached snapshot to sink outside the lock so
+a slow or failing store can't stall viewHandler. If the flush fails
+after retrying, the snapshot is merged back into whatever's
+accumulated in the live map since so counts aren't lost.
 */
 func uploadCounters() error {
 	countersStruct.Lock()
-	// Copy map to backing store
-	// To do this I would copy the map in the mutex, clear it,
-	//then after I have unlocked the mutex I would upload to a service like elastic search
-
-	// Clear map to prevent it from getting to large
-	// This just dereferences the old map and makes a new one. Go's GC will clear the old one on when it is ready
+	snapshot := countersStruct.countersMap
 	countersStruct.countersMap = make(map[string]*counter)
 	countersStruct.Unlock()
 
-	// Upload map copy here
+	if len(snapshot) == 0 {
+		return nil
+	}
+
+	if err := flushWithRetry(snapshot); err != nil {
+		mergeBack(snapshot)
+		return err
+	}
+
 	return nil
 }
 
+/**
+flushWithRetry detaches snapshot into a plain counterstore.Counter map
+and calls sink.Flush, retrying with a doubling backoff on failure.
+*/
+func flushWithRetry(snapshot map[string]*counter) error {
+	plain := make(map[string]counterstore.Counter, len(snapshot))
+	for key, c := range snapshot {
+		c.Lock()
+		plain[key] = counterstore.Counter{View: c.View, Click: c.Click}
+		c.Unlock()
+	}
+
+	backoff := flushBackoff
+	var err error
+	for attempt := 1; attempt <= maxFlushAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		err = sink.Flush(ctx, plain)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if attempt < maxFlushAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return err
+}
+
+/**
+mergeBack adds a failed snapshot's counts into the live map rather
+than overwriting it, since requests may have landed in the new map
+while the flush was in flight.
+*/
+func mergeBack(snapshot map[string]*counter) {
+	countersStruct.Lock()
+	defer countersStruct.Unlock()
+
+	for key, c := range snapshot {
+		c.Lock()
+		view, click := c.View, c.Click
+		c.Unlock()
+
+		live, exists := countersStruct.countersMap[key]
+		if !exists {
+			countersStruct.countersMap[key] = &counter{View: view, Click: click}
+			continue
+		}
+		live.Lock()
+		live.View += view
+		live.Click += click
+		live.Unlock()
+	}
+}
+
 func main() {
+	// adaptiveLimiter backs off a visitor's /view/ rate when its
+	// responses come back 429 or 5xx, and restores it once things are
+	// healthy again. viewHandler's own processRequest/processClick
+	// failures answer 400, which does not count as an error.
+	adaptiveLimiter := rate_limit.New(rate_limit.Config{
+		Store: rate_limit.NewAdaptiveStore(rate_limit.AdaptiveConfig{}),
+	})
+
 	httpMux := http.NewServeMux()
 	// Declare routes and their handlers
 	httpMux.HandleFunc("/", welcomeHandler)
-	httpMux.HandleFunc("/view/", viewHandler)
+	httpMux.Handle("/view/", adaptiveLimiter.Middleware(http.HandlerFunc(viewHandler)))
 	httpMux.HandleFunc("/stats/", statsHandler)
+	httpMux.HandleFunc("/debug/ratelimit", adaptiveLimiter.DebugHandler())
+
+	// /stats/ gets a much stricter limit than /view/, which a single
+	// shared RateLimiter can't express.
+	limiter := rate_limit.NewMultiLimiter(rate_limit.MultiLimiterConfig{
+		KeyFunc: routeAction,
+	})
+	limiter.Add("view", 10, 20)
+	limiter.Add("stats", 1, 1)
+	limiter.Add("default", 1, 5)
 
-	log.Fatal(http.ListenAndServe(":8080", rate_limit.LimitMiddleware(httpMux)))
+	log.Fatal(http.ListenAndServe(":8080", limiter.Middleware(httpMux)))
 }
 
 /**
-Backing store ticker runs as routine on 5 second interval
+Backing store ticker runs as routine on 5 second interval.
+
+uploadCounters already retries and merges failed snapshots back into
+the live map, so a flush error here is just logged rather than treated
+as fatal - closing quit would stop the ticker for the rest of the
+process's life, leaving counts to accumulate in memory forever with no
+way to ever flush them again.
 */
 func init() {
 	// uses ticker channel, adapted from: https://stackoverflow.com/questions/16466320/is-there-a-way-to-do-repetitive-tasks-at-intervals
@@ -156,10 +308,8 @@ func init() {
 		for {
 			select {
 			case <-ticker.C:
-				err := uploadCounters()
-				if err != nil {
+				if err := uploadCounters(); err != nil {
 					fmt.Println(err)
-					close(quit)
 				}
 			case <-quit:
 				ticker.Stop()
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	counterstore "eq/counters"
+	"sync"
+	"testing"
+)
+
+// fakeSink records every snapshot it's handed, optionally failing the
+// first N calls to exercise uploadCounters' retry path.
+type fakeSink struct {
+	mu        sync.Mutex
+	failUntil int
+	calls     int
+	flushed   []map[string]counterstore.Counter
+}
+
+func (s *fakeSink) Flush(ctx context.Context, snapshot map[string]counterstore.Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.failUntil {
+		return context.DeadlineExceeded
+	}
+	s.flushed = append(s.flushed, snapshot)
+	return nil
+}
+
+// withSink swaps the package-level sink for fake for the duration of a
+// test, restoring the original once it's done.
+func withSink(t *testing.T, fake counterstore.Sink) {
+	t.Helper()
+	original := sink
+	sink = fake
+	t.Cleanup(func() { sink = original })
+}
+
+func TestIncrementViewAndClickAreRaceFreeUnderConcurrency(t *testing.T) {
+	countersStruct.Lock()
+	countersStruct.countersMap = make(map[string]*counter)
+	countersStruct.Unlock()
+
+	const workers = 50
+	var wg sync.WaitGroup
+	wg.Add(workers * 2)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			incrementView("key")
+		}()
+		go func() {
+			defer wg.Done()
+			incrementClick("key")
+		}()
+	}
+	wg.Wait()
+
+	countersStruct.Lock()
+	c := countersStruct.countersMap["key"]
+	countersStruct.Unlock()
+
+	if c.View != workers || c.Click != workers {
+		t.Fatalf("expected %d views and clicks, got View=%d Click=%d", workers, c.View, c.Click)
+	}
+}
+
+func TestUploadCountersFlushesAndClearsTheLiveMap(t *testing.T) {
+	fake := &fakeSink{}
+	withSink(t, fake)
+
+	countersStruct.Lock()
+	countersStruct.countersMap = map[string]*counter{
+		"sports:key": {View: 2, Click: 1},
+	}
+	countersStruct.Unlock()
+
+	if err := uploadCounters(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	countersStruct.Lock()
+	remaining := len(countersStruct.countersMap)
+	countersStruct.Unlock()
+	if remaining != 0 {
+		t.Fatalf("expected the live map to be cleared after a successful flush, got %d entries", remaining)
+	}
+
+	if len(fake.flushed) != 1 || fake.flushed[0]["sports:key"].View != 2 {
+		t.Fatalf("expected the snapshot to have been flushed, got %+v", fake.flushed)
+	}
+}
+
+func TestUploadCountersMergesBackOnPersistentFailure(t *testing.T) {
+	fake := &fakeSink{failUntil: maxFlushAttempts}
+	withSink(t, fake)
+
+	countersStruct.Lock()
+	countersStruct.countersMap = map[string]*counter{
+		"sports:key": {View: 2, Click: 1},
+	}
+	countersStruct.Unlock()
+
+	if err := uploadCounters(); err == nil {
+		t.Fatal("expected uploadCounters to report the sink's error")
+	}
+
+	countersStruct.Lock()
+	c := countersStruct.countersMap["sports:key"]
+	countersStruct.Unlock()
+	if c == nil || c.View != 2 || c.Click != 1 {
+		t.Fatalf("expected the failed snapshot to be merged back into the live map, got %+v", c)
+	}
+}
+
+func TestUploadCountersMergeBackAddsToCountsAccumulatedDuringTheFlush(t *testing.T) {
+	fake := &fakeSink{failUntil: maxFlushAttempts}
+	withSink(t, fake)
+
+	countersStruct.Lock()
+	countersStruct.countersMap = make(map[string]*counter)
+	countersStruct.Unlock()
+
+	snapshot := map[string]*counter{"sports:key": {View: 2, Click: 1}}
+
+	// Simulate a request landing in the live map while the (failed)
+	// flush of snapshot was in flight.
+	incrementView("sports:key")
+
+	mergeBack(snapshot)
+
+	countersStruct.Lock()
+	c := countersStruct.countersMap["sports:key"]
+	countersStruct.Unlock()
+	if c.View != 3 || c.Click != 1 {
+		t.Fatalf("expected merge-back to add to counts accumulated during the flush, got View=%d Click=%d", c.View, c.Click)
+	}
+}
@@ -0,0 +1,242 @@
+package rate_limit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+/**
+AdaptiveConfig tunes an AdaptiveStore's AIMD behaviour: error rate is
+tracked per identifier as an EWMA, and the identifier's effective
+rate is multiplicatively decreased once that crosses ErrorThreshold,
+then additively increased back towards MaxRate after CooldownWindow
+of clean traffic, inspired by projectdiscovery/ratelimit's adaptive
+limiter.
+*/
+type AdaptiveConfig struct {
+	// MinRate/MaxRate bound the effective rate a visitor can be
+	// throttled to/restored to.
+	MinRate float64
+	MaxRate float64
+	Burst   int
+
+	// ErrorThreshold is the EWMA error rate (0-1) that triggers a
+	// decrease.
+	ErrorThreshold float64
+	// EWMAAlpha weights how much each outcome moves the error EWMA;
+	// closer to 1 reacts faster, closer to 0 smooths more.
+	EWMAAlpha float64
+	// DecreaseFactor multiplies the effective rate on a decrease,
+	// e.g. 0.5 halves it.
+	DecreaseFactor float64
+	// IncreaseStep is added to the effective rate once CooldownWindow
+	// has passed without another decrease.
+	IncreaseStep float64
+	// CooldownWindow is how long a visitor must go without crossing
+	// ErrorThreshold before its rate is increased again.
+	CooldownWindow time.Duration
+
+	TTL             time.Duration
+	CleanupInterval time.Duration
+}
+
+/**
+adaptiveVisitor is one identifier's adaptive state: its live limiter,
+the effective rate currently applied to it, and the EWMA used to
+decide whether to adjust that rate.
+*/
+type adaptiveVisitor struct {
+	limiter       *rate.Limiter
+	effectiveRate float64
+	errorEWMA     float64
+	lastVisited   time.Time
+	lastDecrease  time.Time
+}
+
+/**
+VisitorStatus is the introspection view of a single visitor, as
+returned by AdaptiveStore.Snapshot for the /debug/ratelimit endpoint.
+*/
+type VisitorStatus struct {
+	EffectiveRate float64   `json:"effective_rate"`
+	ErrorRate     float64   `json:"error_rate"`
+	LastVisited   time.Time `json:"last_visited"`
+}
+
+/**
+AdaptiveStore is a RateLimiterStore whose per-identifier rate shrinks
+when that identifier's downstream error rate (as reported via
+ReportOutcome) gets too high, and grows back once traffic is clean
+again. Plug it in via Config.Store to get adaptive behaviour out of a
+RateLimiter.
+*/
+type AdaptiveStore struct {
+	mu       sync.Mutex
+	visitors map[string]*adaptiveVisitor
+
+	cfg AdaptiveConfig
+
+	ticker *time.Ticker
+	quit   chan struct{}
+}
+
+/**
+NewAdaptiveStore builds an AdaptiveStore from cfg, filling in
+defaults for anything left zero-valued, and starts its cleanup
+goroutine.
+*/
+func NewAdaptiveStore(cfg AdaptiveConfig) *AdaptiveStore {
+	if cfg.MinRate == 0 {
+		cfg.MinRate = 1
+	}
+	if cfg.MaxRate == 0 {
+		cfg.MaxRate = DefaultRate
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = DefaultBurst
+	}
+	if cfg.ErrorThreshold == 0 {
+		cfg.ErrorThreshold = 0.5
+	}
+	if cfg.EWMAAlpha == 0 {
+		cfg.EWMAAlpha = 0.3
+	}
+	if cfg.DecreaseFactor == 0 {
+		cfg.DecreaseFactor = 0.5
+	}
+	if cfg.IncreaseStep == 0 {
+		cfg.IncreaseStep = cfg.MaxRate * 0.1
+	}
+	if cfg.CooldownWindow == 0 {
+		cfg.CooldownWindow = 30 * time.Second
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.CleanupInterval == 0 {
+		cfg.CleanupInterval = DefaultCleanupInterval
+	}
+
+	s := &AdaptiveStore{
+		visitors: make(map[string]*adaptiveVisitor),
+		cfg:      cfg,
+		ticker:   time.NewTicker(cfg.CleanupInterval),
+		quit:     make(chan struct{}),
+	}
+
+	go s.cleanupLoop()
+
+	return s
+}
+
+/**
+Allow reports whether identifier may proceed, creating a new visitor
+at MaxRate on first sight.
+*/
+func (s *AdaptiveStore) Allow(identifier string) (bool, error) {
+	s.mu.Lock()
+	v, exists := s.visitors[identifier]
+	if !exists {
+		v = &adaptiveVisitor{
+			limiter:       rate.NewLimiter(rate.Limit(s.cfg.MaxRate), s.cfg.Burst),
+			effectiveRate: s.cfg.MaxRate,
+			lastVisited:   time.Now(),
+		}
+		s.visitors[identifier] = v
+	} else {
+		v.lastVisited = time.Now()
+	}
+	limiter := v.limiter
+	s.mu.Unlock()
+
+	return limiter.Allow(), nil
+}
+
+/**
+ReportOutcome folds a request's outcome into identifier's error EWMA
+and applies the AIMD adjustment: a decrease the moment the EWMA
+crosses ErrorThreshold, or an increase once CooldownWindow has passed
+since the last decrease. status codes >= 500 or 429 count as errors.
+*/
+func (s *AdaptiveStore) ReportOutcome(identifier string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, exists := s.visitors[identifier]
+	if !exists {
+		return
+	}
+
+	var observed float64
+	if status == 429 || status >= 500 {
+		observed = 1
+	}
+	v.errorEWMA = s.cfg.EWMAAlpha*observed + (1-s.cfg.EWMAAlpha)*v.errorEWMA
+
+	now := time.Now()
+	switch {
+	case v.errorEWMA >= s.cfg.ErrorThreshold:
+		v.effectiveRate *= s.cfg.DecreaseFactor
+		if v.effectiveRate < s.cfg.MinRate {
+			v.effectiveRate = s.cfg.MinRate
+		}
+		v.limiter.SetLimit(rate.Limit(v.effectiveRate))
+		v.lastDecrease = now
+	case v.effectiveRate < s.cfg.MaxRate && now.Sub(v.lastDecrease) >= s.cfg.CooldownWindow:
+		v.effectiveRate += s.cfg.IncreaseStep
+		if v.effectiveRate > s.cfg.MaxRate {
+			v.effectiveRate = s.cfg.MaxRate
+		}
+		v.limiter.SetLimit(rate.Limit(v.effectiveRate))
+	}
+}
+
+/**
+Snapshot returns the current status of every tracked visitor, for
+introspection endpoints like /debug/ratelimit.
+*/
+func (s *AdaptiveStore) Snapshot() map[string]VisitorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]VisitorStatus, len(s.visitors))
+	for id, v := range s.visitors {
+		out[id] = VisitorStatus{
+			EffectiveRate: v.effectiveRate,
+			ErrorRate:     v.errorEWMA,
+			LastVisited:   v.lastVisited,
+		}
+	}
+	return out
+}
+
+func (s *AdaptiveStore) cleanupLoop() {
+	for {
+		select {
+		case <-s.ticker.C:
+			s.sweep()
+		case <-s.quit:
+			s.ticker.Stop()
+			return
+		}
+	}
+}
+
+func (s *AdaptiveStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, v := range s.visitors {
+		if time.Since(v.lastVisited) > s.cfg.TTL {
+			delete(s.visitors, id)
+		}
+	}
+}
+
+/**
+Close stops the cleanup goroutine.
+*/
+func (s *AdaptiveStore) Close() {
+	close(s.quit)
+}
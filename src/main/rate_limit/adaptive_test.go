@@ -0,0 +1,92 @@
+package rate_limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveStoreReportOutcomeDecreasesRateOnErrors(t *testing.T) {
+	store := NewAdaptiveStore(AdaptiveConfig{
+		MinRate:         1,
+		MaxRate:         100,
+		ErrorThreshold:  0.5,
+		EWMAAlpha:       1, // react to a single outcome, for a deterministic test
+		DecreaseFactor:  0.5,
+		CooldownWindow:  time.Hour,
+		TTL:             time.Minute,
+		CleanupInterval: time.Minute,
+	})
+	defer store.Close()
+
+	store.Allow("visitor")
+	if rate := store.Snapshot()["visitor"].EffectiveRate; rate != 100 {
+		t.Fatalf("expected initial effective rate to be MaxRate, got %v", rate)
+	}
+
+	store.ReportOutcome("visitor", 500)
+
+	if rate := store.Snapshot()["visitor"].EffectiveRate; rate != 50 {
+		t.Fatalf("expected rate to halve after a reported server error, got %v", rate)
+	}
+}
+
+func TestAdaptiveStoreReportOutcomeFloorsAtMinRate(t *testing.T) {
+	store := NewAdaptiveStore(AdaptiveConfig{
+		MinRate:         10,
+		MaxRate:         100,
+		ErrorThreshold:  0.5,
+		EWMAAlpha:       1,
+		DecreaseFactor:  0.5,
+		CooldownWindow:  time.Hour,
+		TTL:             time.Minute,
+		CleanupInterval: time.Minute,
+	})
+	defer store.Close()
+
+	store.Allow("visitor")
+	for i := 0; i < 10; i++ {
+		store.ReportOutcome("visitor", 500)
+	}
+
+	if rate := store.Snapshot()["visitor"].EffectiveRate; rate != 10 {
+		t.Fatalf("expected rate to be floored at MinRate, got %v", rate)
+	}
+}
+
+func TestAdaptiveStoreReportOutcomeIncreasesAfterCooldown(t *testing.T) {
+	store := NewAdaptiveStore(AdaptiveConfig{
+		MinRate:         1,
+		MaxRate:         100,
+		ErrorThreshold:  0.5,
+		EWMAAlpha:       1,
+		DecreaseFactor:  0.5,
+		IncreaseStep:    10,
+		CooldownWindow:  10 * time.Millisecond,
+		TTL:             time.Minute,
+		CleanupInterval: time.Minute,
+	})
+	defer store.Close()
+
+	store.Allow("visitor")
+	store.ReportOutcome("visitor", 500) // drop to 50
+
+	time.Sleep(20 * time.Millisecond)
+	store.ReportOutcome("visitor", 200) // clean traffic after the cooldown window
+
+	if rate := store.Snapshot()["visitor"].EffectiveRate; rate != 60 {
+		t.Fatalf("expected rate to additively increase by IncreaseStep after cooldown, got %v", rate)
+	}
+}
+
+func TestAdaptiveStoreReportOutcomeIgnoresUnknownVisitor(t *testing.T) {
+	store := NewAdaptiveStore(AdaptiveConfig{})
+	defer store.Close()
+
+	// visitor was never Allow()'d, so it has no tracked state - this
+	// must not panic.
+	store.ReportOutcome("visitor", 500)
+
+	if _, exists := store.Snapshot()["visitor"]; exists {
+		t.Fatal("reporting an outcome for an unknown visitor should not create one")
+	}
+}
@@ -0,0 +1,139 @@
+package rate_limit
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+gcraEntry tracks a single identifier's theoretical arrival time (tat)
+- the only state GCRA needs per key, compared to MemoryStore's whole
+*rate.Limiter.
+*/
+type gcraEntry struct {
+	tat         time.Time
+	lastVisited time.Time
+}
+
+/**
+GCRAStore is a RateLimiterStore implementing the Generic Cell Rate
+Algorithm, as used by throttled/throttled.v2: each request computes
+newTAT = max(now, tat) + emissionInterval, and allows if
+newTAT - now <= burstOffset. Storing one timestamp per identifier
+instead of a whole limiter makes it cheaper for the many short-lived
+identifiers MemoryStore otherwise accumulates.
+*/
+type GCRAStore struct {
+	mu      sync.Mutex
+	entries map[string]gcraEntry
+
+	emissionInterval time.Duration
+	burstOffset      time.Duration
+	burst            int
+
+	ttl    time.Duration
+	ticker *time.Ticker
+	quit   chan struct{}
+}
+
+/**
+NewGCRAStore builds a GCRAStore allowing ratePerSec requests/sec with
+up to burst of slack, and starts its cleanup goroutine.
+*/
+func NewGCRAStore(ratePerSec float64, burst int, ttl time.Duration, cleanupInterval time.Duration) *GCRAStore {
+	emissionInterval := time.Duration(float64(time.Second) / ratePerSec)
+
+	s := &GCRAStore{
+		entries:          make(map[string]gcraEntry),
+		emissionInterval: emissionInterval,
+		burstOffset:      emissionInterval * time.Duration(burst),
+		burst:            burst,
+		ttl:              ttl,
+		ticker:           time.NewTicker(cleanupInterval),
+		quit:             make(chan struct{}),
+	}
+
+	go s.cleanupLoop()
+
+	return s
+}
+
+/**
+Allow reports whether identifier may proceed under the GCRA: a
+request is allowed (and its tat advanced) as long as doing so doesn't
+push the theoretical arrival time further than burstOffset into the
+future. Denied requests don't advance tat.
+*/
+func (s *GCRAStore) Allow(identifier string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	tat := now
+	if e, exists := s.entries[identifier]; exists && e.tat.After(now) {
+		tat = e.tat
+	}
+
+	newTAT := tat.Add(s.emissionInterval)
+	if newTAT.Sub(now) > s.burstOffset {
+		s.entries[identifier] = gcraEntry{tat: tat, lastVisited: now}
+		return false, nil
+	}
+
+	s.entries[identifier] = gcraEntry{tat: newTAT, lastVisited: now}
+	return true, nil
+}
+
+/**
+Info reports identifier's remaining capacity for the X-RateLimit-*
+headers, derived from how much of burstOffset its tat has used up.
+*/
+func (s *GCRAStore) Info(identifier string) RateLimitInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	tat := now
+	if e, exists := s.entries[identifier]; exists && e.tat.After(now) {
+		tat = e.tat
+	}
+
+	remaining := int((s.burstOffset - tat.Sub(now)) / s.emissionInterval)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining > s.burst {
+		remaining = s.burst
+	}
+
+	return RateLimitInfo{Limit: s.burst, Remaining: remaining, ResetAt: tat}
+}
+
+func (s *GCRAStore) cleanupLoop() {
+	for {
+		select {
+		case <-s.ticker.C:
+			s.sweep()
+		case <-s.quit:
+			s.ticker.Stop()
+			return
+		}
+	}
+}
+
+func (s *GCRAStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range s.entries {
+		if time.Since(e.lastVisited) > s.ttl {
+			delete(s.entries, id)
+		}
+	}
+}
+
+/**
+Close stops the cleanup goroutine.
+*/
+func (s *GCRAStore) Close() {
+	close(s.quit)
+}
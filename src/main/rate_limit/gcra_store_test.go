@@ -0,0 +1,65 @@
+package rate_limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCRAStoreAllowRespectsBurst(t *testing.T) {
+	store := NewGCRAStore(10, 3, time.Minute, time.Minute)
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		allowed, err := store.Allow("visitor")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("request %d should have been allowed within burst", i)
+		}
+	}
+
+	allowed, err := store.Allow("visitor")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Fatal("request beyond burst should have been denied")
+	}
+}
+
+func TestGCRAStoreAllowIsolatesIdentifiers(t *testing.T) {
+	store := NewGCRAStore(10, 1, time.Minute, time.Minute)
+	defer store.Close()
+
+	if allowed, _ := store.Allow("a"); !allowed {
+		t.Fatal("first request for a should be allowed")
+	}
+	if allowed, _ := store.Allow("a"); allowed {
+		t.Fatal("second immediate request for a should be denied")
+	}
+	if allowed, _ := store.Allow("b"); !allowed {
+		t.Fatal("a different identifier should have its own tat and be allowed")
+	}
+}
+
+func TestGCRAStoreInfoReflectsRemainingCapacity(t *testing.T) {
+	store := NewGCRAStore(10, 3, time.Minute, time.Minute)
+	defer store.Close()
+
+	info := store.Info("visitor")
+	if info.Limit != 3 || info.Remaining != 3 {
+		t.Fatalf("expected full capacity before any request, got %+v", info)
+	}
+
+	store.Allow("visitor")
+	if info := store.Info("visitor"); info.Remaining != 2 {
+		t.Fatalf("expected remaining 2 after one request, got %+v", info)
+	}
+
+	store.Allow("visitor")
+	store.Allow("visitor")
+	if info := store.Info("visitor"); info.Remaining != 0 {
+		t.Fatalf("expected remaining 0 once burst is exhausted, got %+v", info)
+	}
+}
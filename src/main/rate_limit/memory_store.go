@@ -0,0 +1,174 @@
+package rate_limit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultMaxVisitors bounds the MemoryStore so a flood of one-off
+// identifiers (e.g. spoofed IPs) can't grow the map without limit
+// between cleanup ticks.
+const DefaultMaxVisitors = 10000
+
+/**
+visitor tracks a single identifier's limiter, when it was last seen,
+and its position in the LRU list.
+*/
+type visitor struct {
+	limiter     *rate.Limiter
+	lastVisited time.Time
+	element     *list.Element
+}
+
+/**
+MemoryStore is the original in-process RateLimiterStore: one
+golang.org/x/time/rate.Limiter per identifier, bounded by an LRU
+eviction policy and swept on an interval for entries that have gone
+stale. Unlike a Redis-backed store its state isn't shared across
+instances, so it only rate limits per-replica.
+*/
+type MemoryStore struct {
+	mu       sync.Mutex
+	visitors map[string]*visitor
+	lru      *list.List
+
+	rate    rate.Limit
+	burst   int
+	ttl     time.Duration
+	maxSize int
+
+	ticker *time.Ticker
+	quit   chan struct{}
+}
+
+/**
+NewMemoryStore builds a MemoryStore and starts its cleanup goroutine.
+ratePerSec/burst configure each visitor's limiter, ttl is how long a
+visitor may go unseen before being swept, and cleanupInterval is how
+often the sweep runs.
+*/
+func NewMemoryStore(ratePerSec float64, burst int, ttl time.Duration, cleanupInterval time.Duration) *MemoryStore {
+	store := &MemoryStore{
+		visitors: make(map[string]*visitor),
+		lru:      list.New(),
+		rate:     rate.Limit(ratePerSec),
+		burst:    burst,
+		ttl:      ttl,
+		maxSize:  DefaultMaxVisitors,
+		ticker:   time.NewTicker(cleanupInterval),
+		quit:     make(chan struct{}),
+	}
+
+	go store.cleanupLoop()
+
+	return store
+}
+
+/**
+Allow reports whether identifier may proceed, creating a new limiter
+for it on first sight and touching its LRU position otherwise.
+*/
+func (s *MemoryStore) Allow(identifier string) (bool, error) {
+	s.mu.Lock()
+	v, exists := s.visitors[identifier]
+	if !exists {
+		v = &visitor{
+			limiter:     rate.NewLimiter(s.rate, s.burst),
+			lastVisited: time.Now(),
+		}
+		v.element = s.lru.PushFront(identifier)
+		s.visitors[identifier] = v
+		s.evictIfFull()
+	} else {
+		v.lastVisited = time.Now()
+		s.lru.MoveToFront(v.element)
+	}
+	limiter := v.limiter
+	s.mu.Unlock()
+
+	return limiter.Allow(), nil
+}
+
+/**
+Info reports identifier's remaining capacity for the X-RateLimit-*
+headers, without creating a visitor for identifiers that haven't been
+seen yet.
+*/
+func (s *MemoryStore) Info(identifier string) RateLimitInfo {
+	s.mu.Lock()
+	v, exists := s.visitors[identifier]
+	s.mu.Unlock()
+
+	if !exists {
+		return RateLimitInfo{Limit: s.burst, Remaining: s.burst, ResetAt: time.Now()}
+	}
+
+	tokens := v.limiter.Tokens()
+	remaining := int(tokens)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	resetAt := time.Now()
+	if tokens < 1 && s.rate > 0 {
+		resetAt = resetAt.Add(time.Duration((1 - tokens) * float64(time.Second) / float64(s.rate)))
+	}
+
+	return RateLimitInfo{Limit: s.burst, Remaining: remaining, ResetAt: resetAt}
+}
+
+/**
+evictIfFull drops the least-recently-used visitor once the map grows
+past maxSize. Caller must hold s.mu.
+*/
+func (s *MemoryStore) evictIfFull() {
+	if s.lru.Len() <= s.maxSize {
+		return
+	}
+	oldest := s.lru.Back()
+	if oldest == nil {
+		return
+	}
+	s.lru.Remove(oldest)
+	delete(s.visitors, oldest.Value.(string))
+}
+
+/**
+cleanupLoop periodically removes visitors that haven't been seen
+within the configured TTL, same cadence as the original package-level
+janitor.
+*/
+func (s *MemoryStore) cleanupLoop() {
+	for {
+		select {
+		case <-s.ticker.C:
+			s.sweep()
+		case <-s.quit:
+			s.ticker.Stop()
+			return
+		}
+	}
+}
+
+func (s *MemoryStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, v := range s.visitors {
+		if time.Since(v.lastVisited) > s.ttl {
+			s.lru.Remove(v.element)
+			delete(s.visitors, id)
+		}
+	}
+}
+
+/**
+Close stops the cleanup goroutine. Stores are long-lived for the
+life of the process so callers typically don't need this outside of
+tests.
+*/
+func (s *MemoryStore) Close() {
+	close(s.quit)
+}
@@ -0,0 +1,83 @@
+package rate_limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreAllowRespectsBurst(t *testing.T) {
+	store := NewMemoryStore(10, 3, time.Minute, time.Minute)
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		allowed, err := store.Allow("visitor")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("request %d should have been allowed within burst", i)
+		}
+	}
+
+	allowed, err := store.Allow("visitor")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Fatal("request beyond burst should have been denied")
+	}
+}
+
+func TestMemoryStoreSweepRemovesExpiredVisitors(t *testing.T) {
+	store := NewMemoryStore(10, 1, 10*time.Millisecond, time.Hour)
+	defer store.Close()
+
+	store.Allow("visitor")
+	if _, exists := store.visitors["visitor"]; !exists {
+		t.Fatal("visitor should be tracked after its first request")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	store.sweep()
+
+	if _, exists := store.visitors["visitor"]; exists {
+		t.Fatal("sweep should have removed a visitor past its TTL")
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsedWhenFull(t *testing.T) {
+	store := NewMemoryStore(10, 1, time.Hour, time.Hour)
+	defer store.Close()
+	store.maxSize = 2
+
+	store.Allow("a")
+	store.Allow("b")
+	// Touch "a" so "b" becomes the least recently used.
+	store.Allow("a")
+	store.Allow("c")
+
+	if _, exists := store.visitors["b"]; exists {
+		t.Fatal("least recently used visitor should have been evicted")
+	}
+	if _, exists := store.visitors["a"]; !exists {
+		t.Fatal("recently touched visitor should still be tracked")
+	}
+	if _, exists := store.visitors["c"]; !exists {
+		t.Fatal("newly added visitor should still be tracked")
+	}
+}
+
+func TestMemoryStoreInfoReflectsRemainingCapacity(t *testing.T) {
+	store := NewMemoryStore(10, 3, time.Minute, time.Minute)
+	defer store.Close()
+
+	info := store.Info("visitor")
+	if info.Limit != 3 || info.Remaining != 3 {
+		t.Fatalf("expected full capacity before any request, got %+v", info)
+	}
+
+	store.Allow("visitor")
+	if info := store.Info("visitor"); info.Remaining != 2 {
+		t.Fatalf("expected remaining 2 after one request, got %+v", info)
+	}
+}
@@ -0,0 +1,316 @@
+package rate_limit
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultShardCount controls how many independent shards back a
+// MultiLimiter's bucket map. Splitting buckets across shards keeps a
+// busy action (e.g. "view") from serializing lookups for an unrelated
+// one (e.g. "stats") behind a single mutex.
+const DefaultShardCount = 32
+
+/**
+KeyFunc maps an incoming request to the name of the policy it should
+be rate limited under, e.g. "/view/" -> "view".
+*/
+type KeyFunc func(*http.Request) string
+
+/**
+policy is the rate/burst pair registered for a single action via Add.
+*/
+type policy struct {
+	rate  rate.Limit
+	burst int
+}
+
+/**
+bucket is one (identifier, action) pair's limiter.
+*/
+type bucket struct {
+	limiter     *rate.Limiter
+	lastVisited time.Time
+}
+
+/**
+shard is one slice of a MultiLimiter's bucket map, independently
+locked and swept so unrelated identifiers/actions don't contend.
+*/
+type shard struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+/**
+MultiLimiterConfig configures a MultiLimiter.
+*/
+type MultiLimiterConfig struct {
+	TTL                 time.Duration
+	CleanupInterval     time.Duration
+	ShardCount          int
+	IdentifierExtractor IdentifierExtractor
+	KeyFunc             KeyFunc
+	DenyHandler         http.HandlerFunc
+	ErrorHandler        func(http.ResponseWriter, *http.Request, error)
+
+	// OnOutcome, if set, is called with the status code each request
+	// to Middleware resulted in, so a caller can feed it into its own
+	// per-action health tracking (e.g. to drive an adaptive policy).
+	// Left nil by default, in which case no response wrapping happens.
+	OnOutcome func(identifier, action string, status int)
+}
+
+/**
+MultiLimiter manages several named rate-limit policies per visitor,
+e.g. a stricter limit for "/stats/" than for "/view/", which a single
+shared RateLimiter can't express since it only knows one rate/burst.
+Each (identifier, action) pair gets its own *rate.Limiter, sharded to
+reduce lock contention, and swept on its own TTL like MemoryStore.
+*/
+type MultiLimiter struct {
+	shards []*shard
+
+	policiesMu sync.RWMutex
+	policies   map[string]policy
+
+	ttl                 time.Duration
+	identifierExtractor IdentifierExtractor
+	keyFunc             KeyFunc
+	denyHandler         http.HandlerFunc
+	errorHandler        func(http.ResponseWriter, *http.Request, error)
+	onOutcome           func(identifier, action string, status int)
+
+	ticker *time.Ticker
+	quit   chan struct{}
+}
+
+/**
+NewMultiLimiter builds a MultiLimiter and starts its cleanup
+goroutine. Register policies with Add before using it as middleware.
+*/
+func NewMultiLimiter(cfg MultiLimiterConfig) *MultiLimiter {
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.CleanupInterval == 0 {
+		cfg.CleanupInterval = DefaultCleanupInterval
+	}
+	if cfg.ShardCount == 0 {
+		cfg.ShardCount = DefaultShardCount
+	}
+	if cfg.IdentifierExtractor == nil {
+		cfg.IdentifierExtractor = DefaultIdentifierExtractor
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = func(r *http.Request) string { return r.URL.Path }
+	}
+	if cfg.DenyHandler == nil {
+		cfg.DenyHandler = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		}
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+
+	shards := make([]*shard, cfg.ShardCount)
+	for i := range shards {
+		shards[i] = &shard{buckets: make(map[string]*bucket)}
+	}
+
+	ml := &MultiLimiter{
+		shards:              shards,
+		policies:            make(map[string]policy),
+		ttl:                 cfg.TTL,
+		identifierExtractor: cfg.IdentifierExtractor,
+		keyFunc:             cfg.KeyFunc,
+		denyHandler:         cfg.DenyHandler,
+		errorHandler:        cfg.ErrorHandler,
+		onOutcome:           cfg.OnOutcome,
+		ticker:              time.NewTicker(cfg.CleanupInterval),
+		quit:                make(chan struct{}),
+	}
+
+	go ml.cleanupLoop()
+
+	return ml
+}
+
+/**
+Add registers the rate/burst policy for an action, e.g.
+ml.Add("view", 10, 20). Policies are guarded by a lock, so Add may
+run alongside Allow, but re-registering an action does not change the
+limiters of (identifier, action) pairs that have already been seen.
+*/
+func (ml *MultiLimiter) Add(action string, ratePerSec float64, burst int) {
+	ml.policiesMu.Lock()
+	defer ml.policiesMu.Unlock()
+	ml.policies[action] = policy{rate: rate.Limit(ratePerSec), burst: burst}
+}
+
+/**
+Allow reports whether identifier may proceed under action's policy,
+creating a limiter for the (identifier, action) pair on first sight.
+*/
+func (ml *MultiLimiter) Allow(identifier, action string) (bool, error) {
+	ml.policiesMu.RLock()
+	p, ok := ml.policies[action]
+	ml.policiesMu.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("rate_limit: no policy registered for action %q", action)
+	}
+
+	s := ml.shardFor(identifier, action)
+	key := identifier + ":" + action
+
+	s.mu.Lock()
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{
+			limiter:     rate.NewLimiter(p.rate, p.burst),
+			lastVisited: time.Now(),
+		}
+		s.buckets[key] = b
+	} else {
+		b.lastVisited = time.Now()
+	}
+	limiter := b.limiter
+	s.mu.Unlock()
+
+	return limiter.Allow(), nil
+}
+
+/**
+Info reports identifier's remaining capacity under action's policy,
+for the X-RateLimit-* headers. Doesn't create a bucket for pairs that
+haven't been seen yet.
+*/
+func (ml *MultiLimiter) Info(identifier, action string) RateLimitInfo {
+	ml.policiesMu.RLock()
+	p, ok := ml.policies[action]
+	ml.policiesMu.RUnlock()
+	if !ok {
+		return RateLimitInfo{}
+	}
+
+	s := ml.shardFor(identifier, action)
+	key := identifier + ":" + action
+
+	s.mu.Lock()
+	b, exists := s.buckets[key]
+	s.mu.Unlock()
+
+	if !exists {
+		return RateLimitInfo{Limit: p.burst, Remaining: p.burst, ResetAt: time.Now()}
+	}
+
+	tokens := b.limiter.Tokens()
+	remaining := int(tokens)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	resetAt := time.Now()
+	if tokens < 1 && p.rate > 0 {
+		resetAt = resetAt.Add(time.Duration((1 - tokens) * float64(time.Second) / float64(p.rate)))
+	}
+
+	return RateLimitInfo{Limit: p.burst, Remaining: remaining, ResetAt: resetAt}
+}
+
+/**
+Middleware enforces the policy selected by KeyFunc for each request,
+keyed by IdentifierExtractor. It emits the same X-RateLimit-* /
+Retry-After headers as RateLimiter.Middleware via the shared
+writeRateLimitHeaders helper, and - if OnOutcome is configured - feeds
+each request's status code back through it via serveWithOutcome, the
+same wrapping RateLimiter.Middleware uses for its adaptive stores.
+*/
+func (ml *MultiLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identifier, err := ml.identifierExtractor(r)
+		if err != nil {
+			ml.errorHandler(w, r, err)
+			return
+		}
+
+		action := ml.keyFunc(r)
+
+		allowed, err := ml.Allow(identifier, action)
+		if err != nil {
+			ml.errorHandler(w, r, err)
+			return
+		}
+
+		writeRateLimitHeaders(w, ml.Info(identifier, action), allowed)
+
+		if !allowed {
+			ml.denyHandler(w, r)
+			return
+		}
+
+		if ml.onOutcome == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		serveWithOutcome(w, r, next, func(status int) {
+			ml.onOutcome(identifier, action, status)
+		})
+	})
+}
+
+/**
+shardFor picks a shard for an (identifier, action) pair using a small
+FNV-1a style hash, so the same pair always lands on the same shard.
+*/
+func (ml *MultiLimiter) shardFor(identifier, action string) *shard {
+	var h uint32 = 2166136261
+	for i := 0; i < len(identifier); i++ {
+		h ^= uint32(identifier[i])
+		h *= 16777619
+	}
+	for i := 0; i < len(action); i++ {
+		h ^= uint32(action[i])
+		h *= 16777619
+	}
+	return ml.shards[h%uint32(len(ml.shards))]
+}
+
+func (ml *MultiLimiter) cleanupLoop() {
+	for {
+		select {
+		case <-ml.ticker.C:
+			ml.sweep()
+		case <-ml.quit:
+			ml.ticker.Stop()
+			return
+		}
+	}
+}
+
+func (ml *MultiLimiter) sweep() {
+	for _, s := range ml.shards {
+		s.mu.Lock()
+		for key, b := range s.buckets {
+			if time.Since(b.lastVisited) > ml.ttl {
+				delete(s.buckets, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+/**
+Close stops the cleanup goroutine.
+*/
+func (ml *MultiLimiter) Close() {
+	close(ml.quit)
+}
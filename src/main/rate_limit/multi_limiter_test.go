@@ -0,0 +1,60 @@
+package rate_limit
+
+import (
+	"testing"
+)
+
+func TestMultiLimiterAllowIsolatesPoliciesPerAction(t *testing.T) {
+	ml := NewMultiLimiter(MultiLimiterConfig{})
+	defer ml.Close()
+
+	ml.Add("view", 100, 5)
+	ml.Add("stats", 100, 1)
+
+	for i := 0; i < 5; i++ {
+		allowed, err := ml.Allow("1.2.3.4", "view")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("view request %d should have been allowed within its burst of 5", i)
+		}
+	}
+	if allowed, _ := ml.Allow("1.2.3.4", "view"); allowed {
+		t.Fatal("view burst of 5 should be exhausted by a 6th request")
+	}
+
+	// stats has its own, stricter policy and must not be affected by
+	// view's bucket for the same identifier.
+	if allowed, err := ml.Allow("1.2.3.4", "stats"); err != nil || !allowed {
+		t.Fatalf("stats request should be allowed independently of view, got allowed=%v err=%v", allowed, err)
+	}
+	if allowed, _ := ml.Allow("1.2.3.4", "stats"); allowed {
+		t.Fatal("stats burst of 1 should be exhausted after a single request")
+	}
+}
+
+func TestMultiLimiterAllowIsolatesPerIdentifier(t *testing.T) {
+	ml := NewMultiLimiter(MultiLimiterConfig{})
+	defer ml.Close()
+	ml.Add("view", 100, 1)
+
+	if allowed, _ := ml.Allow("a", "view"); !allowed {
+		t.Fatal("first request for identifier a should be allowed")
+	}
+	if allowed, _ := ml.Allow("a", "view"); allowed {
+		t.Fatal("second immediate request for identifier a should be denied")
+	}
+	if allowed, _ := ml.Allow("b", "view"); !allowed {
+		t.Fatal("a different identifier should have its own bucket")
+	}
+}
+
+func TestMultiLimiterAllowRejectsUnregisteredAction(t *testing.T) {
+	ml := NewMultiLimiter(MultiLimiterConfig{})
+	defer ml.Close()
+
+	if _, err := ml.Allow("a", "unregistered"); err == nil {
+		t.Fatal("expected an error for an action with no registered policy")
+	}
+}
@@ -1,115 +1,335 @@
 package rate_limit
 
 import (
-	"fmt"
-	"golang.org/x/time/rate"
+	"encoding/json"
 	"net"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 )
 
 /**
-Struct for visited map
+Default tuning parameters, matched to the values the middleware used
+to hard-code before it became configurable
 */
-type user struct {
-	limiter     *rate.Limiter
-	lastVisited time.Time
+const (
+	DefaultRate            = 1
+	DefaultBurst           = 5
+	DefaultTTL             = 5 * time.Minute
+	DefaultCleanupInterval = 5 * time.Second
+)
+
+/**
+RateLimiterStore abstracts the thing that actually decides whether an
+identifier (IP, API token, user ID, ...) is allowed to proceed.
+MemoryStore, RedisStore, GCRAStore and AdaptiveStore are the
+implementations that ship with this package, following the same interface shape as the echo v4
+rate limiter middleware.
+*/
+type RateLimiterStore interface {
+	Allow(identifier string) (bool, error)
 }
 
-var (
-	// Map of visitors to site (key: IP, value: {limiter, lastVisitedTime})
-	visitors = make(map[string]*user)
+/**
+IdentifierExtractor pulls the key used to bucket a request, e.g. the
+caller's IP, an API token, or a user ID. DefaultIdentifierExtractor
+keeps the previous RemoteAddr-based behaviour.
+*/
+type IdentifierExtractor func(*http.Request) (string, error)
+
+/**
+Algorithm selects which built-in store New uses when Config.Store is
+left nil.
+*/
+type Algorithm int
 
-	visitMutex sync.Mutex
+const (
+	// TokenBucket backs visitors with golang.org/x/time/rate, via
+	// MemoryStore.
+	TokenBucket Algorithm = iota
+	// GCRA backs visitors with a GCRAStore, which stores only a
+	// theoretical arrival time per key rather than a whole limiter -
+	// cheaper for workloads with many short-lived identifiers.
+	GCRA
 )
 
 /**
-create a Go routine to regularly cleans up the visited map
-*/
-func init() {
-	ticker := time.NewTicker(5 * time.Second)
-	quit := make(chan struct{})
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				err := cleanUpVisitorsMap()
-				if err != nil {
-					fmt.Println(err)
-					close(quit)
-				}
-			case <-quit:
-				ticker.Stop()
-				return
-			}
+Config configures a RateLimiter. Rate/Burst/TTL/CleanupInterval/
+Algorithm are only used when Store is left nil, in which case New
+builds the selected store from them.
+*/
+type Config struct {
+	Rate            float64
+	Burst           int
+	TTL             time.Duration
+	CleanupInterval time.Duration
+	Algorithm       Algorithm
+
+	// Store lets callers plug in MemoryStore, RedisStore, GCRAStore, or
+	// their own RateLimiterStore implementation. Defaults to the store
+	// selected by Algorithm, built from Rate/Burst/TTL/CleanupInterval.
+	Store RateLimiterStore
+
+	// IdentifierExtractor decides what a visitor is keyed by. Defaults
+	// to the request's RemoteAddr.
+	IdentifierExtractor IdentifierExtractor
+
+	// DenyHandler runs when a request is rate limited. Defaults to a
+	// plain 429.
+	DenyHandler http.HandlerFunc
+
+	// ErrorHandler runs when the store or the IdentifierExtractor
+	// return an error. Defaults to a plain 500.
+	ErrorHandler func(http.ResponseWriter, *http.Request, error)
+}
+
+/**
+RateLimiter wraps a RateLimiterStore with the HTTP plumbing
+(identifier extraction, deny/error responses) needed to use it as
+middleware.
+*/
+type RateLimiter struct {
+	store               RateLimiterStore
+	identifierExtractor IdentifierExtractor
+	denyHandler         http.HandlerFunc
+	errorHandler        func(http.ResponseWriter, *http.Request, error)
+}
+
+/**
+New builds a RateLimiter from cfg, filling in defaults for anything
+left zero-valued. If cfg.Store is nil the store selected by
+cfg.Algorithm (a MemoryStore for TokenBucket, a GCRAStore for GCRA) is
+created from Rate/Burst/TTL/CleanupInterval (falling back to the
+package defaults).
+*/
+func New(cfg Config) *RateLimiter {
+	if cfg.Store == nil {
+		rate := cfg.Rate
+		if rate == 0 {
+			rate = DefaultRate
+		}
+		burst := cfg.Burst
+		if burst == 0 {
+			burst = DefaultBurst
 		}
-	}()
+		ttl := cfg.TTL
+		if ttl == 0 {
+			ttl = DefaultTTL
+		}
+		cleanupInterval := cfg.CleanupInterval
+		if cleanupInterval == 0 {
+			cleanupInterval = DefaultCleanupInterval
+		}
+
+		switch cfg.Algorithm {
+		case GCRA:
+			cfg.Store = NewGCRAStore(rate, burst, ttl, cleanupInterval)
+		default:
+			cfg.Store = NewMemoryStore(rate, burst, ttl, cleanupInterval)
+		}
+	}
+
+	if cfg.IdentifierExtractor == nil {
+		cfg.IdentifierExtractor = DefaultIdentifierExtractor
+	}
+
+	if cfg.DenyHandler == nil {
+		cfg.DenyHandler = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		}
+	}
+
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+
+	return &RateLimiter{
+		store:               cfg.Store,
+		identifierExtractor: cfg.IdentifierExtractor,
+		denyHandler:         cfg.DenyHandler,
+		errorHandler:        cfg.ErrorHandler,
+	}
 }
 
 /**
-Adapted from: https://www.alexedwards.net/blog/how-to-rate-limit-http-requests
-Implementation of a decorator pattern to act as middleware for rate limiter
+DefaultIdentifierExtractor keys visitors by the IP in RemoteAddr, same
+as the original implementation.
 */
+func DefaultIdentifierExtractor(r *http.Request) (string, error) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+	return ip, nil
+}
 
-func LimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
-		// get user IP
-		ip, _, err := net.SplitHostPort(request.RemoteAddr)
+/**
+Middleware is a decorator that enforces the configured RateLimiterStore
+in front of next. If the store also implements outcomeReporter (e.g.
+AdaptiveStore), the wrapped response's status code is captured and fed
+back via ReportOutcome once next has served the request.
+*/
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identifier, err := rl.identifierExtractor(r)
 		if err != nil {
-			http.Error(responseWriter, "Internal Server Error", http.StatusInternalServerError)
+			rl.errorHandler(w, r, err)
+			return
 		}
 
-		// Check if IP has exceeded their rate limit
-		// If they have send StatusTooManyRequests
-		// Else continue to next part of service handler (decorator)
-		if !checkUser(ip).Allow() {
-			http.Error(responseWriter, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		allowed, err := rl.store.Allow(identifier)
+		if err != nil {
+			rl.errorHandler(w, r, err)
 			return
 		}
 
-		next.ServeHTTP(responseWriter, request)
+		rl.setRateLimitHeaders(w, identifier, allowed)
+
+		if !allowed {
+			rl.denyHandler(w, r)
+			return
+		}
+
+		if _, ok := rl.store.(outcomeReporter); !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		serveWithOutcome(w, r, next, func(status int) {
+			rl.ReportOutcome(identifier, status)
+		})
 	})
 }
 
 /**
-Checks map for IP
-If IP does not exist in map, add a record with a new limiter and time else update visited time
+serveWithOutcome serves r through next with w wrapped in a
+statusRecorder, then calls report with the status code the handler
+wrote. Shared by every middleware in this package that needs to feed a
+request's outcome back into its store (RateLimiter.Middleware,
+MultiLimiter.Middleware).
+*/
+func serveWithOutcome(w http.ResponseWriter, r *http.Request, next http.Handler, report func(status int)) {
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(recorder, r)
+	report(recorder.status)
+}
+
+/**
+RateLimitInfo is a store's view of a single identifier's remaining
+capacity, used to populate the X-RateLimit-* / Retry-After response
+headers.
+*/
+type RateLimitInfo struct {
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+/**
+InfoProvider is implemented by RateLimiterStores that can report
+RateLimitInfo for an identifier, e.g. MemoryStore and GCRAStore. Stores
+that don't implement it (RedisStore, AdaptiveStore) simply don't get
+rate-limit headers emitted.
+*/
+type InfoProvider interface {
+	Info(identifier string) RateLimitInfo
+}
+
+/**
+setRateLimitHeaders emits the standard X-RateLimit-Limit,
+X-RateLimit-Remaining and X-RateLimit-Reset headers, plus Retry-After
+when the request was denied, on any store that implements
+InfoProvider. Must be called before the response is written.
+*/
+func (rl *RateLimiter) setRateLimitHeaders(w http.ResponseWriter, identifier string, allowed bool) {
+	provider, ok := rl.store.(InfoProvider)
+	if !ok {
+		return
+	}
+	writeRateLimitHeaders(w, provider.Info(identifier), allowed)
+}
+
+/**
+writeRateLimitHeaders emits the standard X-RateLimit-Limit,
+X-RateLimit-Remaining and X-RateLimit-Reset headers from info, plus
+Retry-After when the request was denied. Shared by every middleware in
+this package (RateLimiter.Middleware, MultiLimiter.Middleware) so the
+header format can't drift between them. Must be called before the
+response is written.
 */
-func checkUser(ip string) *rate.Limiter {
-	visitMutex.Lock()
-	// When function returns, unlock visit_mutex
-	defer visitMutex.Unlock()
+func writeRateLimitHeaders(w http.ResponseWriter, info RateLimitInfo, allowed bool) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(info.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(info.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(info.ResetAt.Unix(), 10))
 
-	// if this is a new user, create a new map entry
-	visitor, exists := visitors[ip]
-	if !exists {
-		// Limiter sets rate limit parameters`
-		// If this was deployed on docker I would make this an environment variable to configure
-		limiter := rate.NewLimiter(1, 5)
-		visitors[ip] = &user{
-			limiter:     limiter,
-			lastVisited: time.Now(),
+	if !allowed {
+		retryAfter := int(time.Until(info.ResetAt).Seconds())
+		if retryAfter < 0 {
+			retryAfter = 0
 		}
-		return limiter
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 	}
+}
+
+/**
+outcomeReporter is implemented by RateLimiterStores that can adjust
+their behaviour based on how a request turned out, e.g. AdaptiveStore.
+*/
+type outcomeReporter interface {
+	ReportOutcome(identifier string, status int)
+}
+
+/**
+ReportOutcome feeds a request's outcome back into the store, if it
+supports it. It's a no-op for stores that don't, so callers can call
+it unconditionally.
+*/
+func (rl *RateLimiter) ReportOutcome(identifier string, status int) {
+	if reporter, ok := rl.store.(outcomeReporter); ok {
+		reporter.ReportOutcome(identifier, status)
+	}
+}
 
-	visitor.lastVisited = time.Now()
-	return visitor.limiter
+/**
+introspectable is implemented by RateLimiterStores that can report
+their current per-visitor state, e.g. AdaptiveStore.
+*/
+type introspectable interface {
+	Snapshot() map[string]VisitorStatus
 }
 
 /**
-Unlike my Node rate limiter that uses Redis this does not expire entries so on an interval I clean up the map
+DebugHandler serves the store's current per-visitor state as JSON, for
+wiring up to a route like /debug/ratelimit. Responds 501 if the store
+doesn't support introspection.
 */
-func cleanUpVisitorsMap() error {
-	visitMutex.Lock()
-	defer visitMutex.Unlock()
-	// check each entry in visitors map
-	// if that IP has not visited in past 5 minutes delete the entry to maintain small map
-	for ip, visitor := range visitors {
-		if time.Now().Sub(visitor.lastVisited) > 5*time.Minute {
-			delete(visitors, ip)
+func (rl *RateLimiter) DebugHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		introspector, ok := rl.store.(introspectable)
+		if !ok {
+			http.Error(w, "rate limiter store does not support introspection", http.StatusNotImplemented)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(introspector.Snapshot()); err != nil {
+			rl.errorHandler(w, r, err)
 		}
 	}
-	return nil
+}
+
+/**
+statusRecorder captures the status code a handler writes so it can be
+reported back to an adaptive store after the fact.
+*/
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
 }
@@ -0,0 +1,77 @@
+package rate_limit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+/**
+RedisStore is a RateLimiterStore backed by Redis, so the limit is
+shared across every replica of the service instead of being tracked
+per-process like MemoryStore. It implements a fixed-window counter:
+each identifier gets a key for the current window, INCR'd on every
+request and EXPIRE'd to the window size the first time it's created.
+*/
+type RedisStore struct {
+	client *redis.Client
+	limit  int64
+	window time.Duration
+	prefix string
+}
+
+/**
+NewRedisStore builds a RedisStore allowing up to limit requests per
+window per identifier. prefix namespaces the keys this store writes,
+which is useful when several RedisStores share one Redis instance.
+*/
+func NewRedisStore(client *redis.Client, limit int64, window time.Duration, prefix string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		limit:  limit,
+		window: window,
+		prefix: prefix,
+	}
+}
+
+/**
+Allow atomically increments identifier's counter for the current
+window and reports whether it's still within limit. The window's
+expiry is set only when the key is first created so it can't be
+pushed back out by later requests.
+*/
+func (s *RedisStore) Allow(identifier string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	key := s.windowKey(identifier)
+
+	count, err := s.client.Incr(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("rate_limit: redis incr failed: %w", err)
+	}
+
+	if count == 1 {
+		if err := s.client.Expire(ctx, key, s.window).Err(); err != nil {
+			return false, fmt.Errorf("rate_limit: redis expire failed: %w", err)
+		}
+	}
+
+	return count <= s.limit, nil
+}
+
+/**
+windowKey buckets identifier into the current fixed window so old
+counters naturally age out instead of needing to be cleaned up.
+
+Computed from milliseconds rather than whole seconds, since truncating
+s.window to int64(s.window.Seconds()) divides by zero for any
+sub-second window (e.g. 500*time.Millisecond, which NewRedisStore has
+no reason to reject).
+*/
+func (s *RedisStore) windowKey(identifier string) string {
+	window := time.Now().UnixMilli() / s.window.Milliseconds()
+	return fmt.Sprintf("%s:%s:%d", s.prefix, identifier, window)
+}
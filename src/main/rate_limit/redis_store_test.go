@@ -0,0 +1,73 @@
+package rate_limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedisStore spins up an in-memory miniredis server and a real
+// *redis.Client pointed at it, so RedisStore is exercised against an
+// actual (if fake) Redis protocol implementation rather than a mocked
+// interface.
+func newTestRedisStore(t *testing.T, limit int64, window time.Duration) *RedisStore {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisStore(client, limit, window, "test")
+}
+
+func TestRedisStoreAllowRespectsLimit(t *testing.T) {
+	store := newTestRedisStore(t, 3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		allowed, err := store.Allow("visitor")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("request %d should have been allowed within limit", i)
+		}
+	}
+
+	allowed, err := store.Allow("visitor")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Fatal("request beyond limit should have been denied")
+	}
+}
+
+func TestRedisStoreAllowIsolatesIdentifiers(t *testing.T) {
+	store := newTestRedisStore(t, 1, time.Minute)
+
+	if allowed, _ := store.Allow("a"); !allowed {
+		t.Fatal("first request for a should be allowed")
+	}
+	if allowed, _ := store.Allow("a"); allowed {
+		t.Fatal("second immediate request for a should be denied")
+	}
+	if allowed, _ := store.Allow("b"); !allowed {
+		t.Fatal("a different identifier should have its own window")
+	}
+}
+
+// TestRedisStoreAllowHandlesSubSecondWindows guards against the
+// windowKey divide-by-zero this store used to hit for any window
+// under one second.
+func TestRedisStoreAllowHandlesSubSecondWindows(t *testing.T) {
+	store := newTestRedisStore(t, 1, 200*time.Millisecond)
+
+	if allowed, err := store.Allow("visitor"); err != nil || !allowed {
+		t.Fatalf("first request should be allowed, got allowed=%v err=%v", allowed, err)
+	}
+	if allowed, err := store.Allow("visitor"); err != nil || allowed {
+		t.Fatalf("second immediate request should be denied, got allowed=%v err=%v", allowed, err)
+	}
+}